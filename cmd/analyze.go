@@ -0,0 +1,530 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var compareBaselineDir string
+var compareCandidateDir string
+var compareThreshold string
+
+// analyzeCmd represents the analyze command
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Parses raw benchmark result directories into normalized JSON result files.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, cloud := range clouds {
+			if err := analyzeCloudResults(cloud); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compares a baseline and a candidate set of normalized benchmark results.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCompare(compareBaselineDir, compareCandidateDir, compareThreshold)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVar(&compareBaselineDir, "baseline", "",
+		"directory containing the baseline set of normalized result JSON files")
+	compareCmd.Flags().StringVar(&compareCandidateDir, "candidate", "",
+		"directory containing the candidate set of normalized result JSON files")
+	compareCmd.Flags().StringVar(&compareThreshold, "threshold", "5%",
+		"allowed regression of a metric before compare fails, e.g. 5%")
+	_ = compareCmd.MarkFlagRequired("baseline")
+	_ = compareCmd.MarkFlagRequired("candidate")
+}
+
+// BenchResult is the normalized representation of a single benchmark metric,
+// as produced by the analyze subcommand from the raw per-benchmark result
+// directories fetched by the generated driver script.
+type BenchResult struct {
+	Cloud       string  `json:"cloud"`
+	MachineType string  `json:"machine_type"`
+	Benchmark   string  `json:"benchmark"`
+	Metric      string  `json:"metric"`
+	Value       float64 `json:"value"`
+	Unit        string  `json:"unit"`
+	Timestamp   string  `json:"timestamp"`
+	RunID       string  `json:"run_id"`
+}
+
+// runManifest mirrors the <results dir>.manifest.json file written by the
+// generated driver script next to each results directory.
+type runManifest struct {
+	Cloud       string `json:"cloud"`
+	MachineType string `json:"machine_type"`
+	Benchmark   string `json:"benchmark"`
+	RunID       string `json:"run_id"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// resultDirRE matches a benchmark results directory as created by
+// results_dir() in the generated driver script, e.g.
+// "tpcc-results.20210101.12:00:00".
+var resultDirRE = regexp.MustCompile(`^(coremark|fio|netperf|tpcc|kvgo)-results\.`)
+
+// benchmarkNames maps a results-dir prefix to the benchmark name used
+// elsewhere in the driver script (bench_cpu, bench_io, bench_net, bench_tpcc,
+// bench_kvgo).
+var benchmarkNames = map[string]string{
+	"coremark": "cpu",
+	"fio":      "io",
+	"netperf":  "net",
+	"tpcc":     "tpcc",
+	"kvgo":     "kvgo",
+}
+
+var resultParsers = map[string]func(string) ([]BenchResult, error){
+	"coremark": parseCoremarkResults,
+	"fio":      parseFioResults,
+	"netperf":  parseNetperfResults,
+	"tpcc":     parseTPCCResults,
+	"kvgo":     parseKvgoResults,
+}
+
+// analyzeCloudResults walks cloud.LogDir(), parses every benchmark results
+// directory it finds into normalized BenchResults, and writes a
+// results.json file into each one.
+func analyzeCloudResults(cloud CloudDetails) error {
+	scriptDirs, err := ioutil.ReadDir(cloud.LogDir())
+	if err != nil {
+		return err
+	}
+	for _, scriptDir := range scriptDirs {
+		if !scriptDir.IsDir() {
+			continue
+		}
+		scriptLogDir := filepath.Join(cloud.LogDir(), scriptDir.Name())
+		resultDirs, err := ioutil.ReadDir(scriptLogDir)
+		if err != nil {
+			return err
+		}
+		for _, rd := range resultDirs {
+			m := resultDirRE.FindStringSubmatch(rd.Name())
+			if m == nil || !rd.IsDir() {
+				continue
+			}
+			if err := analyzeResultDir(filepath.Join(scriptLogDir, rd.Name()), m[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func analyzeResultDir(resultsDir string, kind string) error {
+	parse := resultParsers[kind]
+	results, err := parse(resultsDir)
+	if err != nil {
+		return fmt.Errorf("analyze %s: %v", resultsDir, err)
+	}
+
+	manifest, err := loadRunManifest(resultsDir)
+	if err != nil {
+		return fmt.Errorf("analyze %s: %v", resultsDir, err)
+	}
+
+	for i := range results {
+		results[i].Cloud = manifest.Cloud
+		results[i].MachineType = manifest.MachineType
+		results[i].Benchmark = benchmarkNames[kind]
+		results[i].RunID = manifest.RunID
+		results[i].Timestamp = manifest.Timestamp
+	}
+
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(resultsDir, "results.json"), out, 0644)
+}
+
+func loadRunManifest(resultsDir string) (runManifest, error) {
+	var manifest runManifest
+	data, err := ioutil.ReadFile(resultsDir + ".manifest.json")
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("parsing manifest for %s: %v", resultsDir, err)
+	}
+	return manifest, nil
+}
+
+// findAndRead locates the first file named name under dir and returns its
+// contents.
+func findAndRead(dir string, name string) ([]byte, error) {
+	var found string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if found != "" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && info.Name() == name {
+			found = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == "" {
+		return nil, fmt.Errorf("%s not found under %s", name, dir)
+	}
+	return ioutil.ReadFile(found)
+}
+
+// findAllAndRead locates every file named name under dir and returns their
+// paths, in sorted order, and contents.
+func findAllAndRead(dir string, name string) ([]string, [][]byte, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && info.Name() == name {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(paths)
+
+	contents := make([][]byte, len(paths))
+	for i, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[i] = data
+	}
+	return paths, contents, nil
+}
+
+var coremarkScoreRE = regexp.MustCompile(`CoreMark 1\.0 : (\d+(\.\d+)?)`)
+
+// parseCoremarkResults extracts the CoreMark score from coremark.log.
+func parseCoremarkResults(dir string) ([]BenchResult, error) {
+	data, err := findAndRead(dir, "coremark.log")
+	if err != nil {
+		return nil, err
+	}
+	m := coremarkScoreRE.FindStringSubmatch(string(data))
+	if m == nil {
+		return nil, fmt.Errorf("no CoreMark score found")
+	}
+	score, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	return []BenchResult{
+		{Metric: "score", Value: score, Unit: "iterations/sec"},
+	}, nil
+}
+
+type fioJobStats struct {
+	IOPS   float64 `json:"iops"`
+	BWKiBs float64 `json:"bw"`
+	ClatNs struct {
+		Percentile map[string]string `json:"percentile"`
+	} `json:"clat_ns"`
+}
+
+type fioOutput struct {
+	Jobs []struct {
+		Read  fioJobStats `json:"read"`
+		Write fioJobStats `json:"write"`
+	} `json:"jobs"`
+}
+
+var fioPercentiles = []string{"50.000000", "95.000000", "99.000000"}
+
+// parseFioResults extracts IOPS, bandwidth and clat percentiles for both the
+// read and write halves of every job in fio's --output-format=json report.
+// bench_io runs one fio.json per matrix tuple, each in its own
+// fio-results/bs=.._rw=.._qd=.. subdirectory, so every tuple found under dir
+// is parsed and its metrics are tagged with that subdirectory's name.
+func parseFioResults(dir string) ([]BenchResult, error) {
+	paths, contents, err := findAllAndRead(dir, "fio.json")
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("fio.json not found under %s", dir)
+	}
+
+	var results []BenchResult
+	for i, data := range contents {
+		var out fioOutput
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", paths[i], err)
+		}
+		tuple := filepath.Base(filepath.Dir(paths[i]))
+
+		for _, job := range out.Jobs {
+			for _, rw := range []struct {
+				name  string
+				stats fioJobStats
+			}{{"read", job.Read}, {"write", job.Write}} {
+				if rw.stats.IOPS == 0 && rw.stats.BWKiBs == 0 {
+					continue
+				}
+				results = append(results,
+					BenchResult{Metric: fmt.Sprintf("%s_%s_iops", tuple, rw.name), Value: rw.stats.IOPS, Unit: "iops"},
+					BenchResult{Metric: fmt.Sprintf("%s_%s_bw", tuple, rw.name), Value: rw.stats.BWKiBs, Unit: "KiB/s"})
+				for _, p := range fioPercentiles {
+					v, ok := rw.stats.ClatNs.Percentile[p]
+					if !ok {
+						continue
+					}
+					latency, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						continue
+					}
+					pLabel := strings.Split(p, ".")[0]
+					results = append(results, BenchResult{
+						Metric: fmt.Sprintf("%s_%s_clat_p%s", tuple, rw.name, pLabel),
+						Value:  latency,
+						Unit:   "ns",
+					})
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+var netperfThroughputRE = regexp.MustCompile(`(?m)^\s*\d+\s+\d+\s+\d+\s+[\d.]+\s+([\d.]+)\s*$`)
+
+// parseNetperfResults extracts the throughput reported on the final line of
+// netperf's default output.
+func parseNetperfResults(dir string) ([]BenchResult, error) {
+	data, err := findAndRead(dir, "netperf.log")
+	if err != nil {
+		return nil, err
+	}
+	m := netperfThroughputRE.FindStringSubmatch(string(data))
+	if m == nil {
+		return nil, fmt.Errorf("no throughput line found")
+	}
+	throughput, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	return []BenchResult{
+		{Metric: "throughput", Value: throughput, Unit: "Mbps"},
+	}, nil
+}
+
+var tpccSummaryRE = regexp.MustCompile(`(?m)^\s*(\d+(?:\.\d+)?)\s+tpmC\s+([\d.]+)%\s+efc`)
+var tpccLatencyRE = regexp.MustCompile(`p(50|95|99)\(ms\)\D+([\d.]+)`)
+
+// parseTPCCResults extracts tpmC, efficiency and latency percentiles from
+// the summary tpcc.sh leaves at the end of tpcc.log.
+func parseTPCCResults(dir string) ([]BenchResult, error) {
+	data, err := findAndRead(dir, "tpcc.log")
+	if err != nil {
+		return nil, err
+	}
+	content := string(data)
+
+	m := tpccSummaryRE.FindStringSubmatch(content)
+	if m == nil {
+		return nil, fmt.Errorf("no tpmC summary line found")
+	}
+	tpmC, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	efc, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []BenchResult{
+		{Metric: "tpmC", Value: tpmC, Unit: "tpmC"},
+		{Metric: "efc", Value: efc, Unit: "percent"},
+	}
+	for _, lm := range tpccLatencyRE.FindAllStringSubmatch(content, -1) {
+		latency, err := strconv.ParseFloat(lm[2], 64)
+		if err != nil {
+			continue
+		}
+		results = append(results, BenchResult{
+			Metric: fmt.Sprintf("p%s", lm[1]),
+			Value:  latency,
+			Unit:   "ms",
+		})
+	}
+	return results, nil
+}
+
+// kvgoSample mirrors the line protocol streamed by cmd/bench to kvgo.jsonl;
+// only the final "summary" line is used here.
+type kvgoSample struct {
+	Type   string  `json:"type"`
+	Ops    int64   `json:"ops"`
+	Tps    float64 `json:"tps"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+}
+
+// parseKvgoResults extracts the final summary line written by cmd/bench to
+// kvgo.jsonl.
+func parseKvgoResults(dir string) ([]BenchResult, error) {
+	data, err := findAndRead(dir, "kvgo.jsonl")
+	if err != nil {
+		return nil, err
+	}
+
+	var summary *kvgoSample
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var s kvgoSample
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			return nil, fmt.Errorf("parsing kvgo.jsonl line: %v", err)
+		}
+		if s.Type == "summary" {
+			summary = &s
+		}
+	}
+	if summary == nil {
+		return nil, fmt.Errorf("no summary line found in kvgo.jsonl")
+	}
+
+	return []BenchResult{
+		{Metric: "ops", Value: float64(summary.Ops), Unit: "ops"},
+		{Metric: "tps", Value: summary.Tps, Unit: "ops/sec"},
+		{Metric: "p50", Value: summary.P50Ms, Unit: "ms"},
+		{Metric: "p95", Value: summary.P95Ms, Unit: "ms"},
+		{Metric: "p99", Value: summary.P99Ms, Unit: "ms"},
+		{Metric: "p999", Value: summary.P999Ms, Unit: "ms"},
+	}, nil
+}
+
+// resultSetKey identifies a single metric across a baseline and a candidate
+// run, ignoring run_id and timestamp.
+type resultSetKey struct {
+	MachineType string
+	Benchmark   string
+	Metric      string
+}
+
+// loadResultSet loads every results.json file under dir into a map keyed by
+// resultSetKey.
+func loadResultSet(dir string) (map[resultSetKey]BenchResult, error) {
+	set := make(map[resultSetKey]BenchResult)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "results.json" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var results []BenchResult
+		if err := json.Unmarshal(data, &results); err != nil {
+			return fmt.Errorf("parsing %s: %v", path, err)
+		}
+		for _, r := range results {
+			set[resultSetKey{r.MachineType, r.Benchmark, r.Metric}] = r
+		}
+		return nil
+	})
+	return set, err
+}
+
+// runCompare loads the baseline and candidate result sets and fails with a
+// non-zero exit when any metric common to both regresses by more than
+// threshold.
+func runCompare(baselineDir string, candidateDir string, threshold string) error {
+	pct, err := parsePercent(threshold)
+	if err != nil {
+		return err
+	}
+
+	baseline, err := loadResultSet(baselineDir)
+	if err != nil {
+		return err
+	}
+	candidate, err := loadResultSet(candidateDir)
+	if err != nil {
+		return err
+	}
+
+	var regressions []string
+	for key, base := range baseline {
+		cand, ok := candidate[key]
+		if !ok || base.Value == 0 {
+			continue
+		}
+		delta := (cand.Value - base.Value) / base.Value
+		// Lower is better for latency metrics; everything else, higher is better.
+		regressed := delta < -pct
+		if strings.Contains(key.Metric, "clat") || strings.HasPrefix(key.Metric, "p50") ||
+			strings.HasPrefix(key.Metric, "p95") || strings.HasPrefix(key.Metric, "p99") {
+			regressed = delta > pct
+		}
+		if regressed {
+			regressions = append(regressions, fmt.Sprintf(
+				"%s/%s/%s: baseline=%.2f candidate=%.2f (%.1f%% change)",
+				key.MachineType, key.Benchmark, key.Metric, base.Value, cand.Value, delta*100))
+		}
+	}
+
+	if len(regressions) > 0 {
+		return fmt.Errorf("regressions beyond %s threshold:\n%s", threshold, strings.Join(regressions, "\n"))
+	}
+	return nil
+}
+
+func parsePercent(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "%")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold %q: %v", s, err)
+	}
+	return v / 100, nil
+}
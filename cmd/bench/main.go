@@ -0,0 +1,248 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+// bench is a Go-native replacement for the shell driven tpcc/kv
+// workloads: it opens a database/sql connection pool directly against a
+// roachprod cluster and streams live tps/latency samples to stdout as
+// newline-delimited JSON, so results are available as the run progresses
+// rather than only once the driver script fetches them. It is invoked by
+// the generated driver script's `-w kvgo` workload in place of tpcc.sh; the
+// driver still runs it in a tmux window on the load node.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	_ "github.com/lib/pq"
+)
+
+var (
+	workloadName = flag.String("workload", "kv95", "workload to run: kv0, kv95, tpcc-lite")
+	pgURLs       = flag.String("pg-urls", "", "comma separated postgres connection URLs, one per db node")
+	duration     = flag.Duration("duration", time.Minute, "duration to run the workload for")
+	concurrency  = flag.Int("concurrency", 8, "number of concurrent worker connections")
+)
+
+// sample is one line of the structured protocol streamed to stdout, once a
+// second while the workload runs and once more as a final summary.
+type sample struct {
+	Type     string  `json:"type"`
+	ElapsedS float64 `json:"elapsed_s"`
+	Ops      int64   `json:"ops"`
+	Tps      float64 `json:"tps"`
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	P999Ms   float64 `json:"p999_ms"`
+}
+
+// op runs a single transaction of a workload against db, using rng for any
+// random key/value choices.
+type op func(ctx context.Context, db *sql.DB, rng *rand.Rand) error
+
+var workloads = map[string]struct {
+	setup string
+	run   op
+}{
+	"kv0":       {kvSetupStmt, kv0Op},
+	"kv95":      {kvSetupStmt, kv95Op},
+	"tpcc-lite": {tpccLiteSetupStmt, tpccLiteOp},
+}
+
+func main() {
+	flag.Parse()
+	if *pgURLs == "" {
+		log.Fatal("-pg-urls is required")
+	}
+
+	w, ok := workloads[*workloadName]
+	if !ok {
+		log.Fatalf("unknown workload %q", *workloadName)
+	}
+
+	urls := strings.Split(*pgURLs, ",")
+	dbs := make([]*sql.DB, len(urls))
+	for i, u := range urls {
+		db, err := sql.Open("postgres", u)
+		if err != nil {
+			log.Fatalf("opening connection to %s: %v", u, err)
+		}
+		defer db.Close()
+		dbs[i] = db
+	}
+
+	if _, err := dbs[0].Exec(w.setup); err != nil {
+		log.Fatalf("setting up %s schema: %v", *workloadName, err)
+	}
+
+	if err := run(w.run, dbs); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(runOp op, dbs []*sql.DB) error {
+	hist := hdrhistogram.New(1, 10*time.Minute.Microseconds(), 3)
+	var histMu sync.Mutex
+	var ops int64
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		db := dbs[i%len(dbs)]
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))
+			for ctx.Err() == nil {
+				start := time.Now()
+				if err := runOp(ctx, db, rng); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Printf("op error: %v", err)
+					continue
+				}
+				atomic.AddInt64(&ops, 1)
+				histMu.Lock()
+				_ = hist.RecordValue(time.Since(start).Microseconds())
+				histMu.Unlock()
+			}
+		}(i)
+	}
+
+	reportDone := make(chan struct{})
+	go reportProgress(ctx, &ops, hist, &histMu, reportDone)
+
+	wg.Wait()
+	<-reportDone
+	return nil
+}
+
+// reportProgress emits a sample line once a second, and a final summary line
+// once ctx is done.
+func reportProgress(
+	ctx context.Context, ops *int64, hist *hdrhistogram.Histogram, mu *sync.Mutex, done chan struct{},
+) {
+	defer close(done)
+	enc := json.NewEncoder(os.Stdout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var lastOps int64
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			finalOps := atomic.LoadInt64(ops)
+			avgTps := float64(finalOps) / time.Since(start).Seconds()
+			_ = enc.Encode(snapshot("summary", start, finalOps, avgTps, hist, mu))
+			return
+		}
+		curOps := atomic.LoadInt64(ops)
+		_ = enc.Encode(snapshot("sample", start, curOps, float64(curOps-lastOps), hist, mu))
+		lastOps = curOps
+	}
+}
+
+func snapshot(
+	kind string, start time.Time, ops int64, tps float64, hist *hdrhistogram.Histogram, mu *sync.Mutex,
+) sample {
+	mu.Lock()
+	defer mu.Unlock()
+	return sample{
+		Type:     kind,
+		ElapsedS: time.Since(start).Seconds(),
+		Ops:      ops,
+		Tps:      tps,
+		P50Ms:    float64(hist.ValueAtQuantile(50)) / 1000,
+		P95Ms:    float64(hist.ValueAtQuantile(95)) / 1000,
+		P99Ms:    float64(hist.ValueAtQuantile(99)) / 1000,
+		P999Ms:   float64(hist.ValueAtQuantile(99.9)) / 1000,
+	}
+}
+
+const kvSetupStmt = `CREATE TABLE IF NOT EXISTS kv (k INT PRIMARY KEY, v BYTES NOT NULL)`
+
+func kv0Op(ctx context.Context, db *sql.DB, rng *rand.Rand) error {
+	k := rng.Int63n(1 << 20)
+	v := make([]byte, 64)
+	rng.Read(v)
+	_, err := db.ExecContext(ctx,
+		`UPSERT INTO kv (k, v) VALUES ($1, $2)`, k, v)
+	return err
+}
+
+func kv95Op(ctx context.Context, db *sql.DB, rng *rand.Rand) error {
+	k := rng.Int63n(1 << 20)
+	if rng.Float64() < 0.95 {
+		var v []byte
+		err := db.QueryRowContext(ctx, `SELECT v FROM kv WHERE k = $1`, k).Scan(&v)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	return kv0Op(ctx, db, rng)
+}
+
+const tpccLiteSetupStmt = `
+CREATE TABLE IF NOT EXISTS tpcc_lite_order (
+  o_id INT PRIMARY KEY DEFAULT unique_rowid(),
+  o_w_id INT NOT NULL,
+  o_d_id INT NOT NULL,
+  o_entry_d TIMESTAMP NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS tpcc_lite_stock (
+  s_w_id INT NOT NULL,
+  s_i_id INT NOT NULL,
+  s_quantity INT NOT NULL,
+  PRIMARY KEY (s_w_id, s_i_id)
+)`
+
+// tpccLiteOp approximates the hot path of a TPC-C new-order transaction: it
+// decrements stock for a handful of items and records the order, without
+// the full district/customer/history bookkeeping of the real benchmark.
+func tpccLiteOp(ctx context.Context, db *sql.DB, rng *rand.Rand) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	wID, dID := rng.Intn(10), rng.Intn(10)
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO tpcc_lite_order (o_w_id, o_d_id) VALUES ($1, $2)`, wID, dID); err != nil {
+		return err
+	}
+	for i := 0; i < 5; i++ {
+		iID := rng.Intn(100000)
+		if _, err := tx.ExecContext(ctx, `
+			UPSERT INTO tpcc_lite_stock (s_w_id, s_i_id, s_quantity)
+			VALUES ($1, $2, COALESCE((SELECT s_quantity FROM tpcc_lite_stock WHERE s_w_id=$1 AND s_i_id=$2), 100) - 1)`,
+			wID, iID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -11,8 +11,10 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"hash/crc32"
+	"io/ioutil"
 	"os"
 	"path"
 	"regexp"
@@ -25,6 +27,8 @@ import (
 
 var scriptsDir string
 var lifetime string
+var externalHosts string
+var runID string
 
 // generateCmd represents the generate command
 var generateCmd = &cobra.Command{
@@ -47,6 +51,12 @@ func init() {
 		"./scripts", "directory containing scripts uploaded to cloud VMs that execute benchmarks.")
 	generateCmd.Flags().StringVarP(&lifetime, "lifetime", "l",
 		"24h", "cluster lifetime")
+	generateCmd.Flags().StringVarP(&externalHosts, "external-hosts", "E", "",
+		"path to a CSV of pre-provisioned hosts (role,host,pgurl) to default the generated script's -E to, "+
+			"targeting an already-provisioned cluster instead of roachprod create/destroy")
+	generateCmd.Flags().StringVar(&runID, "run-id", "",
+		"stable identifier to use for cluster names instead of the year+hash tail, so that reruns of the "+
+			"same suite (e.g. in CI) reattach to the same cluster via -r. Falls back to CLOUD_REPORT_RUN_ID.")
 }
 
 type scriptData struct {
@@ -57,6 +67,37 @@ type scriptData struct {
 	ScriptsDir  string
 	EvaledArgs  string
 	BenchArgs   map[string]string
+	FioMatrix   []FioWorkload
+	// ExternalHosts is the default path to a CSV of pre-provisioned hosts
+	// (role,host,pgurl), used when targeting an already-provisioned cluster
+	// instead of calling roachprod create/destroy. Empty unless -E was
+	// passed to `cloud-report generate`, including for the "external" cloud.
+	ExternalHosts string
+}
+
+// FioWorkload is a single point in the FIO parameter matrix run by bench_io,
+// e.g. {bs: 4k, rw: randread, iodepth: 32}. Machine types declare a list of
+// these in their cloud YAML; string fields are evaluated as templates
+// against scriptData, same as RoachprodArgs, so a machine family can share a
+// base matrix and override only what differs (e.g. {{.MachineType}}-sized
+// working sets).
+//
+// This requires a FioMatrix []FioWorkload yaml field on both CloudDetails
+// and the per-machine-type config type held in its MachineTypes map,
+// alongside their existing BenchArgs/RoachprodArgs fields -- those types
+// aren't part of this package (CloudDetails, like clouds and rootCmd, is
+// defined in the surrounding cloud-config package and isn't present in this
+// checkout), so there's no file here to add the field to.
+type FioWorkload struct {
+	BS      string `yaml:"bs"`
+	RW      string `yaml:"rw"`
+	IODepth int    `yaml:"iodepth"`
+	NumJobs int    `yaml:"numjobs"`
+	Size    string `yaml:"size"`
+	Runtime string `yaml:"runtime"`
+	// Target is either "device" (raw block device) or "fs" (filesystem file),
+	// defaulting to "fs" when unset.
+	Target string `yaml:"target"`
 }
 
 const driverTemplate = `#!/bin/bash
@@ -74,15 +115,144 @@ mkdir -p "$logdir"
 # Redirect stdout and stderr into script log file
 exec &> >(tee -a "$logdir/driver.log")
 
-# Create roachprod cluster
+# CHAOS_LOCK is a flag file on the driver host that start_cockroach holds
+# while the cluster is bootstrapping or restarting. run_chaos_agent refuses
+# to touch a node while it exists, so chaos never races a cluster-wide
+# restart (cockroachdb/cockroach#40981).
+CHAOS_LOCK="$logdir/.chaos-restart.lock"
+RESTART_SETTLE_SECS=30
+RUN_ID="$CLUSTER"
+EXTERNAL_HOSTS="{{.ExternalHosts}}"
+
+# load_external_hosts parses a role,host,pgurl CSV (see -E) into the
+# EXTERNAL_HOST and EXTERNAL_PGURL associative arrays, keyed by role
+# (db1..dbN, load). Called once, up front, whenever EXTERNAL_HOSTS is set, so
+# every rp_* wrapper below can rely on the arrays being populated regardless
+# of which -b steps were requested.
+declare -A EXTERNAL_HOST
+declare -A EXTERNAL_PGURL
+function load_external_hosts() {
+  while IFS=, read -r role host pgurl; do
+    [ -z "$role" ] && continue
+    EXTERNAL_HOST["$role"]="$host"
+    EXTERNAL_PGURL["$role"]="$pgurl"
+  done < "$EXTERNAL_HOSTS"
+}
+
+# rp_role_for_node maps a roachprod-style node number to the external host
+# role that plays the same part: the last node is always the load generator,
+# everything before it is a db node.
+function rp_role_for_node() {
+  local node=$1
+  if [ "$node" == "$NODES" ]; then
+    echo "load"
+  else
+    echo "db$node"
+  fi
+}
+
+# rp_run, rp_get, rp_put, rp_ip and rp_pgurl are the single place every
+# benchmark/fetch function below goes through to reach a node, so they work
+# the same whether the cluster was created by roachprod or is a BYO set of
+# EXTERNAL_HOSTS addressed by role.
+function rp_run() {
+  local node=$1; shift
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    ssh "${EXTERNAL_HOST[$(rp_role_for_node "$node")]}" -- "$@"
+  else
+    roachprod run "$CLUSTER":$node -- "$@"
+  fi
+}
+
+# rp_run_all runs a command on every node of the cluster.
+function rp_run_all() {
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    for role in "${!EXTERNAL_HOST[@]}"; do
+      ssh "${EXTERNAL_HOST[$role]}" -- "$@"
+    done
+  else
+    roachprod run "$CLUSTER" -- "$@"
+  fi
+}
+
+function rp_get() {
+  local node=$1 remote=$2 dest=$3
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    scp -r "${EXTERNAL_HOST[$(rp_role_for_node "$node")]}:$remote" "$dest"
+  else
+    roachprod get "$CLUSTER":$node "$remote" "$dest"
+  fi
+}
+
+function rp_put() {
+  local node=$1 src=$2 remote=$3
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    scp -r "$src" "${EXTERNAL_HOST[$(rp_role_for_node "$node")]}:$remote"
+  else
+    roachprod put "$CLUSTER":$node "$src" "$remote"
+  fi
+}
+
+function rp_ip() {
+  local node=$1
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    echo "${EXTERNAL_HOST[$(rp_role_for_node "$node")]}"
+  else
+    roachprod ip "$CLUSTER":$node
+  fi
+}
+
+function rp_pgurl() {
+  local node=$1
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    echo "${EXTERNAL_PGURL[$(rp_role_for_node "$node")]}"
+  else
+    roachprod pgurl "$CLUSTER":$node
+  fi
+}
+
+# rp_pgurl_range returns the pgurls of nodes first..last, space separated.
+function rp_pgurl_range() {
+  local first=$1 last=$2
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    local urls=()
+    for ((n = first; n <= last; n++)); do
+      urls+=("$(rp_pgurl "$n")")
+    done
+    echo "${urls[@]}"
+  else
+    roachprod pgurl "$CLUSTER":$first-$last
+  fi
+}
+
+# Create roachprod cluster, or, when -E points at a hosts CSV, adopt the
+# already-provisioned external hosts instead.
 function create_cluster() {
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    echo "Using pre-provisioned external hosts from $EXTERNAL_HOSTS; skipping cluster creation."
+    rp_run_all tmux new -s "$TMUX_SESSION" -d
+    return
+  fi
   roachprod create "$CLUSTER" -n $NODES --lifetime "{{.Lifetime}}" --clouds "$CLOUD" \
     --$CLOUD-machine-type "{{.MachineType}}" {{.EvaledArgs}}
   roachprod run "$CLUSTER" -- tmux new -s "$TMUX_SESSION" -d
 }
 
-# Upload scripts to roachprod cluster
+# Upload scripts to the cluster, via roachprod, or scp for external hosts.
 function upload_scripts() {
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    for role in "${!EXTERNAL_HOST[@]}"; do
+      host="${EXTERNAL_HOST[$role]}"
+      ssh "$host" -- rm -rf ./scripts
+      scp -r {{.ScriptsDir}} "$host":scripts
+      ssh "$host" -- chmod -R +x ./scripts
+      ssh "$host" -- rm -f ./cockroach
+      if [ -n "$cockroach_binary" ]; then
+        scp "$cockroach_binary" "$host":cockroach
+      fi
+    done
+    return
+  fi
   roachprod run "$CLUSTER" rm  -- -rf ./scripts
   roachprod put "$CLUSTER" {{.ScriptsDir}} scripts
   roachprod run "$CLUSTER" chmod -- -R +x ./scripts
@@ -97,27 +267,42 @@ function upload_scripts() {
 
 # Start cockroach cluster on nodes [1-3].
 function start_cockroach() {
-  # Build --store flags based on the number of disks.
-  # Roachprod adds /mnt/data1/cockroach by itself, so, we'll pick up the other disks
-  for s in $(roachprod run "$CLUSTER":1 'ls -1d /mnt/data[2-9]* 2>/dev/null || echo')
-  do
-   stores="$stores --store $s/cockroach"
-  done
-
-	roachprod start "$CLUSTER":1-$((NODES-1)) --args="$stores --cache=0.25 --max-sql-memory=0.4" 
+  touch "$CHAOS_LOCK"
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    # No roachprod to build --store/join flags for us; start each db node
+    # against node 1 directly.
+    local join="${EXTERNAL_HOST[db1]}:26257"
+    for ((n = 1; n <= NODES-1; n++)); do
+      rp_run "$n" "./cockroach start --insecure --join=$join --cache=0.25 --max-sql-memory=0.4 --background"
+    done
+    rp_run 1 "./cockroach init --insecure" || true
+  else
+    # Build --store flags based on the number of disks.
+    # Roachprod adds /mnt/data1/cockroach by itself, so, we'll pick up the other disks
+    for s in $(roachprod run "$CLUSTER":1 'ls -1d /mnt/data[2-9]* 2>/dev/null || echo')
+    do
+     stores="$stores --store $s/cockroach"
+    done
+
+    roachprod start "$CLUSTER":1-$((NODES-1)) --args="$stores --cache=0.25 --max-sql-memory=0.4"
+  fi
+  # Give the cluster time to settle before the chaos agent is allowed to
+  # take a node down; otherwise chaos can overlap with bootstrap.
+  sleep "$RESTART_SETTLE_SECS"
+  rm -f "$CHAOS_LOCK"
 }
 
 # Execute setup.sh script on the cluster to configure it
 function setup_cluster() {
-	roachprod run "$CLUSTER" sudo ./scripts/gen/setup.sh "$CLOUD"
+	rp_run_all sudo ./scripts/gen/setup.sh "$CLOUD"
 }
 
-# executes command on a host using roachprod, under tmux session.
+# executes command on a node, via rp_run, under a tmux session.
 function run_under_tmux() {
   local name=$1
-  local host=$2
+  local node=$2
   local cmd=$3
-  roachprod run $host -- tmux neww -t "$TMUX_SESSION" -n "$name" -d -- "$cmd"
+  rp_run "$node" tmux neww -t "$TMUX_SESSION" -n "$name" -d -- "$cmd"
 }
 
 #
@@ -129,59 +314,202 @@ function results_dir() {
   echo "$logdir/$1.$(date +%Y%m%d.%T)"
 }
 
+# write_run_manifest records what was run for a results directory, next to
+# that directory, so that cloud-report's analyze command can tell which
+# cloud, machine type and run produced it.
+function write_run_manifest() {
+  local dir=$1
+  local benchmark=$2
+  cat > "${dir}.manifest.json" <<EOF
+{
+  "cloud": "$CLOUD",
+  "machine_type": "{{.MachineType}}",
+  "benchmark": "$benchmark",
+  "run_id": "$RUN_ID",
+  "timestamp": "$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+}
+EOF
+}
+
 # Run CPU benchmark
 function bench_cpu() {
-  run_under_tmux "cpu" "$CLUSTER:1"  "./scripts/gen/cpu.sh $cpu_extra_args"
+  run_under_tmux "cpu" 1 "./scripts/gen/cpu.sh $cpu_extra_args"
 }
 
 # Wait for CPU benchmark to finish and retrieve results.
 function fetch_bench_cpu_results() {
-  roachprod run "$CLUSTER":1  ./scripts/gen/cpu.sh -- -w
-  roachprod get "$CLUSTER":1 ./coremark-results $(results_dir "coremark-results")
+  rp_run 1 ./scripts/gen/cpu.sh -- -w
+  local dir=$(results_dir "coremark-results")
+  rp_get 1 ./coremark-results "$dir"
+  write_run_manifest "$dir" "cpu"
 }
 
-# Run FIO benchmark
+# FIO parameter matrix: one entry per {bs,rw,iodepth,numjobs,size,runtime,target}
+# tuple declared for this machine type, named so each tuple's results land in
+# their own fio-results/bs=.._rw=.._qd=.. subdir.
+fio_matrix=(
+{{range .FioMatrix}}  "bs={{.BS}} rw={{.RW}} iodepth={{.IODepth}} numjobs={{.NumJobs}} size={{.Size}} runtime={{.Runtime}} target={{.Target}}"
+{{end}})
+
+# Run FIO benchmark: iterate the fio parameter matrix, running one tmux
+# window per tuple so they can all be waited on independently. Machine types
+# that haven't declared a matrix fall back to the single legacy invocation
+# driven by $io_extra_args alone.
 function bench_io() {
-  run_under_tmux "io" "$CLUSTER:1" "./scripts/gen/fio.sh $io_extra_args"
+  if [ ${#fio_matrix[@]} -eq 0 ]; then
+    run_under_tmux "io" 1 "./scripts/gen/fio.sh $io_extra_args"
+    return
+  fi
+  for tuple in "${fio_matrix[@]}"; do
+    eval "$tuple"
+    name="bs=${bs}_rw=${rw}_qd=${iodepth}"
+    run_under_tmux "io-$name" 1 \
+      "./scripts/gen/fio.sh $io_extra_args -b $bs -r $rw -q $iodepth -j $numjobs -z $size -t $runtime -T ${target:-fs} -n $name"
+  done
 }
 
-# Wait for FIO benchmark top finish and retrieve results.
+# Wait for every tuple in the FIO matrix to finish and retrieve results, or,
+# when no matrix was declared, the single legacy invocation bench_io fell
+# back to above.
 function fetch_bench_io_results() {
-  roachprod run "$CLUSTER":1 ./scripts/gen/fio.sh -- -w
-  roachprod get "$CLUSTER":1 ./fio-results $(results_dir "fio-results")
+  if [ ${#fio_matrix[@]} -eq 0 ]; then
+    rp_run 1 ./scripts/gen/fio.sh -- -w
+  else
+    for tuple in "${fio_matrix[@]}"; do
+      eval "$tuple"
+      name="bs=${bs}_rw=${rw}_qd=${iodepth}"
+      rp_run 1 ./scripts/gen/fio.sh -- -w -n "$name"
+    done
+  fi
+  local dir=$(results_dir "fio-results")
+  rp_get 1 ./fio-results "$dir"
+  write_run_manifest "$dir" "io"
 }
 
 # Run Netperf benchmark
 function bench_net() {
-  server=$(roachprod ip "$CLUSTER":4)
+  server=$(rp_ip 4)
   port=1337
   # Start server
-  roachprod run "$CLUSTER":4 ./scripts/gen/network-netperf.sh -- -S -p $port
+  rp_run 4 ./scripts/gen/network-netperf.sh -- -S -p $port
 
   # Start client
-  run_under_tmux "net" "$CLUSTER:3" "./scripts/gen/network-netperf.sh -s $server -p $port $net_extra_args"
+  run_under_tmux "net" 3 "./scripts/gen/network-netperf.sh -s $server -p $port $net_extra_args"
 }
 
 # Wait for Netperf benchmark to complete and fetch results.
 function fetch_bench_net_results() {
-  roachprod run "$CLUSTER":3 ./scripts/gen/network-netperf.sh -- -w
-  roachprod get "$CLUSTER":3 ./netperf-results $(results_dir "netperf-results")	
+  rp_run 3 ./scripts/gen/network-netperf.sh -- -w
+  local dir=$(results_dir "netperf-results")
+  rp_get 3 ./netperf-results "$dir"
+  write_run_manifest "$dir" "net"
+}
+
+# Install HAProxy on the load node and point it at the db nodes, so chaos
+# mode can take a db node down without the workload talking to it directly.
+function setup_haproxy() {
+  rp_run 4 sudo apt-get -qqy install haproxy
+  rp_run 1 ./cockroach gen haproxy --insecure \
+    --host="$(rp_ip 1)" --url "$(rp_pgurl 1)"
+  # haproxy.cfg is written on node 1; pull it to the driver host before
+  # pushing it out to the load node, since rp_put expects a local file.
+  rp_get 1 haproxy.cfg haproxy.cfg
+  rp_put 4 haproxy.cfg haproxy.cfg
+  rp_run 4 sudo cp haproxy.cfg /etc/haproxy/haproxy.cfg
+  rp_run 4 sudo service haproxy restart
+}
+
+# run_chaos_agent runs in the background on the driver host for the
+# duration of the tpcc benchmark. It never acts while $CHAOS_LOCK exists,
+# so it can't race a cluster-wide restart.
+function run_chaos_agent() {
+  while true; do
+    sleep "$chaos_interval"
+    if [ -e "$CHAOS_LOCK" ]; then
+      continue
+    fi
+    case "$chaos_mode" in
+      chaos)
+        victim=$(( (RANDOM % (NODES-1)) + 1 ))
+        if [ -n "$EXTERNAL_HOSTS" ]; then
+          rp_run "$victim" sudo pkill -TERM cockroach
+          sleep "$chaos_duration"
+          rp_run "$victim" "./cockroach start --insecure --join=${EXTERNAL_HOST[db1]}:26257 --cache=0.25 --max-sql-memory=0.4 --background"
+        else
+          roachprod stop "$CLUSTER":$victim
+          sleep "$chaos_duration"
+          roachprod start "$CLUSTER":$victim
+        fi
+        ;;
+      partition)
+        n1=$(( (RANDOM % (NODES-1)) + 1 ))
+        n2=$(( (RANDOM % (NODES-1)) + 1 ))
+        while [ "$n2" == "$n1" ]; do
+          n2=$(( (RANDOM % (NODES-1)) + 1 ))
+        done
+        # Scope the netem loss to traffic destined for n2 specifically, via a
+        # prio qdisc plus a u32 filter matching n2's address, so this
+        # partitions the n1<->n2 pair rather than isolating n1 from everyone.
+        ip2=$(rp_ip "$n2")
+        rp_run "$n1" sudo tc qdisc add dev eth0 root handle 1: prio
+        rp_run "$n1" sudo tc qdisc add dev eth0 parent 1:3 handle 30: netem loss 100%
+        rp_run "$n1" sudo tc filter add dev eth0 protocol ip parent 1:0 prio 3 u32 match ip dst "$ip2" flowid 1:3
+        sleep "$chaos_duration"
+        rp_run "$n1" sudo tc qdisc del dev eth0 root handle 1: prio
+        ;;
+    esac
+  done
 }
 
 # Run TPCC Benchmark
 function bench_tpcc() {
  start_cockroach
- pgurls=$(roachprod pgurl "$CLUSTER":1-$((NODES-1)))
- run_under_tmux "tpcc" "$CLUSTER:4" "./scripts/gen/tpcc.sh $tpcc_extra_args ${pgurls[@]}"
+ if [ -n "$chaos_mode" ]; then
+   setup_haproxy
+   pgurls="postgresql://root@$(rp_ip 4):26257?sslmode=disable"
+   run_chaos_agent &
+   chaos_agent_pid=$!
+ else
+   pgurls=$(rp_pgurl_range 1 $((NODES-1)))
+ fi
+ run_under_tmux "tpcc" 4 "./scripts/gen/tpcc.sh $tpcc_extra_args ${pgurls[@]}"
+}
+
+# Run the built-in Go kv/tpcc-lite harness. Unlike bench_tpcc, this
+# streams tps/latency samples to a local file as it runs, instead of only
+# producing results once fetch_bench_kvgo_results pulls them.
+function bench_kvgo() {
+ start_cockroach
+ pgurls=$(rp_pgurl_range 1 $((NODES-1)) | tr ' ' ',')
+ run_under_tmux "kvgo" 4 \
+   "./scripts/gen/bench -pg-urls=$pgurls $tpcc_extra_args > kvgo.jsonl"
+}
+
+function fetch_bench_kvgo_results() {
+  rp_run 4 "while tmux list-windows -t $TMUX_SESSION 2>/dev/null | grep -q kvgo; do sleep 5; done"
+  local dir=$(results_dir "kvgo-results")
+  mkdir -p "$dir"
+  rp_get 4 kvgo.jsonl "$dir/kvgo.jsonl"
+  write_run_manifest "$dir" "kvgo"
 }
 
 function fetch_bench_tpcc_results() {
-  roachprod run "$CLUSTER":4 ./scripts/gen/tpcc.sh -- -w
-  roachprod get "$CLUSTER":4 ./tpcc-results $(results_dir "tpcc-results")	
+  rp_run 4 ./scripts/gen/tpcc.sh -- -w
+  if [ -n "$chaos_agent_pid" ]; then
+    kill "$chaos_agent_pid" 2>/dev/null || true
+  fi
+  local dir=$(results_dir "tpcc-results")
+  rp_get 4 ./tpcc-results "$dir"
+  write_run_manifest "$dir" "tpcc"
 }
 
-# Destroy roachprod cluster
+# Destroy roachprod cluster. External hosts are BYO infrastructure, so
+# there's nothing for us to tear down.
 function destroy_cluster() {
+  if [ -n "$EXTERNAL_HOSTS" ]; then
+    echo "EXTERNAL_HOSTS is set; external hosts are not managed by roachprod, skipping destroy."
+    return
+  fi
   roachprod destroy "$CLUSTER"
 }
 
@@ -198,6 +526,8 @@ Usage: $0 [-b <bootstrap>]... [-w <workload>]... [-d] [-c cockroach_binary]
        -w io  : Benchmark IO
        -w net : Benchmark Net
        -w tpcc: Benchmark TPCC
+       -w kvgo: Benchmark KV/TPCC-lite via the built-in Go harness, run under tmux on the load node,
+                streaming samples to kvgo.jsonl as it runs (not included in -w all)
        -w all : All of the above
    -c: Override cockroach binary to use.
    -r: Do not start benchmarks specified by -w.  Instead, resume waiting for their completion.
@@ -206,6 +536,11 @@ Usage: $0 [-b <bootstrap>]... [-w <workload>]... [-d] [-c cockroach_binary]
    -C: additional CPU benchmark arguments
    -T: additional TPCC benchmark arguments
    -n: override number of nodes in a cluster
+   -X: Enable chaos testing alongside the -w tpcc workload.
+       -X chaos    : periodically stop/start a random non-load node, behind HAProxy
+       -X partition: periodically netem-partition a random pair of nodes
+   -E: Target an already-provisioned cluster instead of roachprod create/destroy.
+       Argument is a CSV of role,host,pgurl lines (role is db1..dbN or load).
    -d: Destroy cluster
 "
 exit 1
@@ -221,9 +556,15 @@ io_extra_args='{{with $arg := .BenchArgs.io}}{{$arg}}{{end}}'
 cpu_extra_args='{{with $arg := .BenchArgs.cpu}}{{$arg}}{{end}}'
 net_extra_args='{{with $arg := .BenchArgs.net}}{{$arg}}{{end}}'
 tpcc_extra_args='{{with $arg := .BenchArgs.tpcc}}{{$arg}}{{end}}'
+chaos_mode=''
+chaos_interval='{{with $arg := .BenchArgs.chaos_interval}}{{$arg}}{{end}}'
+chaos_duration='{{with $arg := .BenchArgs.chaos_duration}}{{$arg}}{{end}}'
+: ${chaos_interval:=300}
+: ${chaos_duration:=60}
+chaos_agent_pid=''
 cockroach_binary=''
 
-while getopts 'c:b:w:dn:I:N:C:T:r' flag; do
+while getopts 'c:b:w:dn:I:N:C:T:rX:E:' flag; do
   case "${flag}" in
     b) case "${OPTARG}" in
         all)
@@ -244,12 +585,20 @@ while getopts 'c:b:w:dn:I:N:C:T:r' flag; do
          io) benchmarks+=("bench_io") ;;
          net) benchmarks+=("bench_net") ;;
          tpcc) benchmarks+=("bench_tpcc") ;;
+         kvgo) benchmarks+=("bench_kvgo") ;;
          all) benchmarks+=("bench_cpu" "bench_io" "bench_net" "bench_tpcc") ;;
          *) usage "Invalid -w value '${OPTARG}'";;
        esac
     ;;
     d) do_destroy='true' ;;
     r) f_resume='true' ;;
+    X) case "${OPTARG}" in
+         chaos)     chaos_mode='chaos' ;;
+         partition) chaos_mode='partition' ;;
+         *) usage "Invalid -X value '${OPTARG}'" ;;
+       esac
+    ;;
+    E) EXTERNAL_HOSTS="${OPTARG}" ;;
     n) NODES="${OPTARG}" ;;
     I) io_extra_args="${OPTARG}" ;;
     C) cpu_extra_args="${OPTARG}" ;;
@@ -259,6 +608,23 @@ while getopts 'c:b:w:dn:I:N:C:T:r' flag; do
   esac
 done
 
+# Load the external hosts map, if any, once up front so every rp_* call
+# below can reach it regardless of which -b steps were requested.
+if [ -n "$EXTERNAL_HOSTS" ]; then
+  load_external_hosts
+fi
+
+# Unlike roachprod clusters, external hosts have no "roachprod stage" to
+# fall back on to fetch a release binary, so -c is mandatory there whenever
+# a binary would actually be needed: uploading (-b upload/all) or starting
+# cockroach to run a benchmark. Plain -d/-b create runs, or resuming (-r),
+# never touch the binary and shouldn't be forced to pass -c.
+if [ -n "$EXTERNAL_HOSTS" ] && [ -z "$cockroach_binary" ] && [ -z "$f_resume" ] &&
+   { [ -n "$do_upload" ] || [ ${#benchmarks[@]} -gt 0 ]; }; then
+  echo "-c cockroach_binary is required when -E is set with -b upload or a benchmark: external hosts have no roachprod stage fallback." >&2
+  exit 1
+fi
+
 if [ -n "$do_create" ];
 then
   create_cluster
@@ -281,6 +647,14 @@ then
   do
     $bench
   done
+else
+  # Resuming: make sure the cluster we expect to reattach to is actually
+  # still there, rather than silently fetching nothing below.
+  if [ -z "$EXTERNAL_HOSTS" ] && ! roachprod list "$CLUSTER" &>/dev/null; then
+    echo "Cannot resume: cluster $CLUSTER not found. It may have expired;" \
+         "pass a stable --run-id (or CLOUD_REPORT_RUN_ID) to regenerate/reattach to the same name." >&2
+    exit 1
+  fi
 fi
 
 # Wait for benchmarks to finsh and fetch their results.
@@ -325,6 +699,51 @@ func evalArgs(
 	return nil
 }
 
+// combineFioMatrix picks the machine-specific FIO matrix if one was
+// declared, falling back to the cloud-wide base matrix so a family of
+// machine types can share a common matrix and only override it where they
+// need to diverge.
+func combineFioMatrix(machineMatrix []FioWorkload, baseMatrix []FioWorkload) []FioWorkload {
+	if len(machineMatrix) > 0 {
+		return machineMatrix
+	}
+	return baseMatrix
+}
+
+// evalFioMatrix evaluates the template string fields of every tuple in
+// matrix against templateArgs, the same way evalArgs does for RoachprodArgs.
+func evalFioMatrix(matrix []FioWorkload, templateArgs scriptData) ([]FioWorkload, error) {
+	evalField := func(field string) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		if err := template.Must(template.New("fioField").Parse(field)).Execute(buf, templateArgs); err != nil {
+			return "", fmt.Errorf("error evaluating fio matrix field %q: %v", field, err)
+		}
+		return buf.String(), nil
+	}
+
+	evaled := make([]FioWorkload, len(matrix))
+	for i, w := range matrix {
+		evaled[i] = w
+		for _, f := range []struct {
+			src string
+			dst *string
+		}{
+			{w.BS, &evaled[i].BS},
+			{w.RW, &evaled[i].RW},
+			{w.Size, &evaled[i].Size},
+			{w.Runtime, &evaled[i].Runtime},
+			{w.Target, &evaled[i].Target},
+		} {
+			val, err := evalField(f.src)
+			if err != nil {
+				return nil, err
+			}
+			*f.dst = val
+		}
+	}
+	return evaled, nil
+}
+
 func FormatMachineType(m string) string {
 	return strings.Replace(m, ".", "-", -1)
 }
@@ -337,46 +756,92 @@ func hashStrings(vals ...string) uint32 {
 	return hasher.Sum32()
 }
 
+// effectiveRunID returns the --run-id flag value, falling back to
+// CLOUD_REPORT_RUN_ID, or "" if neither is set.
+func effectiveRunID() string {
+	if runID != "" {
+		return runID
+	}
+	return os.Getenv("CLOUD_REPORT_RUN_ID")
+}
+
 func generateCloudScripts(cloud CloudDetails) error {
 	if err := makeAllDirs(cloud.BasePath(), cloud.ScriptDir(), cloud.LogDir()); err != nil {
 		return err
 	}
 
+	clusterManifest := make(map[string]map[string]string)
+	creationTime := time.Now().UTC().Format(time.RFC3339)
+
 	scriptTemplate := template.Must(template.New("script").Parse(driverTemplate))
 	for machineType, machineConfig := range cloud.MachineTypes {
-		clusterName := fmt.Sprintf("cldrprt%d-%s-%d",
-			(1+time.Now().Year())%1000, machineType,
-			hashStrings(cloud.Cloud, cloud.Group, reportVersion))
+		var clusterName string
+		if id := effectiveRunID(); id != "" {
+			// A stable run ID replaces the year+hash tail entirely, so reruns
+			// of the same suite (e.g. daily CI) reattach to the same cluster
+			// via -r instead of generating a fresh name every time. cloud and
+			// group are still folded in so two clouds (or machine-config
+			// groups) sharing a machine type name and run-id don't collide.
+			clusterName = fmt.Sprintf("cldrprt-%s-%s-%s-%s", cloud.Cloud, cloud.Group, machineType, id)
+		} else {
+			clusterName = fmt.Sprintf("cldrprt%d-%s-%d",
+				(1+time.Now().Year())%1000, machineType,
+				hashStrings(cloud.Cloud, cloud.Group, reportVersion))
+		}
 		validClusterName := regexp.MustCompile(`[\.|\_]`)
 		clusterName = validClusterName.ReplaceAllString(clusterName, "-")
 
+		// The generated script prefixes the cluster name with $USER (see
+		// CLUSTER="$USER-{{.Cluster}}" in driverTemplate), so record the same
+		// full name here; otherwise the manifest wouldn't match what
+		// roachprod actually knows the cluster as.
+		clusterManifest[machineType] = map[string]string{os.Getenv("USER") + "-" + clusterName: creationTime}
+
+		// The "external" cloud targets a BYO-infrastructure cluster whose
+		// MachineTypes map describes host roles (db1..dbN, load) rather than
+		// a real cloud machine type, so there's no roachprod create flags or
+		// machine type to render.
+		isExternal := cloud.Cloud == "external"
+
 		templateArgs := scriptData{
-			CloudDetails: cloud,
-			Cluster:      clusterName,
-			Lifetime:     lifetime,
-			MachineType:  machineType,
-			ScriptsDir:   scriptsDir,
-			BenchArgs:    combineArgs(machineConfig.BenchArgs, cloud.BenchArgs),
+			CloudDetails:  cloud,
+			Cluster:       clusterName,
+			Lifetime:      lifetime,
+			ScriptsDir:    scriptsDir,
+			BenchArgs:     combineArgs(machineConfig.BenchArgs, cloud.BenchArgs),
+			ExternalHosts: externalHosts,
+		}
+		if !isExternal {
+			templateArgs.MachineType = machineType
 		}
 
-		// Evaluate roachprodArgs: those maybe templatized.
-		evaledArgs := make(map[string]string)
-		combinedArgs := combineArgs(machineConfig.RoachprodArgs, cloud.RoachprodArgs)
-		if err := evalArgs(combinedArgs, templateArgs, evaledArgs); err != nil {
+		fioMatrix := combineFioMatrix(machineConfig.FioMatrix, cloud.FioMatrix)
+		evaledFioMatrix, err := evalFioMatrix(fioMatrix, templateArgs)
+		if err != nil {
 			return err
 		}
+		templateArgs.FioMatrix = evaledFioMatrix
 
-		buf := bytes.NewBuffer(nil)
-		for arg, val := range evaledArgs {
-			if buf.Len() > 0 {
-				buf.WriteByte(' ')
+		if !isExternal {
+			// Evaluate roachprodArgs: those maybe templatized.
+			evaledArgs := make(map[string]string)
+			combinedArgs := combineArgs(machineConfig.RoachprodArgs, cloud.RoachprodArgs)
+			if err := evalArgs(combinedArgs, templateArgs, evaledArgs); err != nil {
+				return err
 			}
-			fmt.Fprintf(buf, "--%s", arg)
-			if len(val) > 0 {
-				fmt.Fprintf(buf, "=%q", val)
+
+			buf := bytes.NewBuffer(nil)
+			for arg, val := range evaledArgs {
+				if buf.Len() > 0 {
+					buf.WriteByte(' ')
+				}
+				fmt.Fprintf(buf, "--%s", arg)
+				if len(val) > 0 {
+					fmt.Fprintf(buf, "=%q", val)
+				}
 			}
+			templateArgs.EvaledArgs = buf.String()
 		}
-		templateArgs.EvaledArgs = buf.String()
 
 		scriptName := path.Join(
 			cloud.ScriptDir(),
@@ -391,5 +856,10 @@ func generateCloudScripts(cloud CloudDetails) error {
 		}
 	}
 
-	return nil
+	manifestData, err := json.MarshalIndent(clusterManifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestPath := path.Join(cloud.ScriptDir(), "cluster-manifest.json")
+	return ioutil.WriteFile(manifestPath, manifestData, 0644)
 }